@@ -21,10 +21,16 @@
 package dlog
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kjsanger/logshim"
@@ -66,14 +72,64 @@ func translateLevel(level logshim.Level) (levelName, error) {
 	return lvn, err
 }
 
+// outputFormat selects how a StdLogger renders its messages.
+type outputFormat int
+
+const (
+	textFormat outputFormat = iota
+	jsonFormat
+)
+
+// defaultCallerSkip is the number of stack frames between runtime.Caller
+// and the user's call site, for the direct call chain
+// e.g. Error() -> newMessage() -> callerInfo() -> runtime.Caller.
+const defaultCallerSkip = 3
+
 type StdLogger struct {
-	name  string
-	Level logshim.Level
+	name   string
+	Level  logshim.Level
+	format outputFormat
+	writer io.Writer
+	mu     *sync.Mutex
+
+	// DisableCaller turns off caller capture for this logger, for use on
+	// hot paths where the cost of runtime.Caller is unwelcome.
+	DisableCaller bool
+	// CallerSkip is the number of stack frames passed to runtime.Caller
+	// when capturing the caller. New and NewJSON set it to
+	// defaultCallerSkip; callers that wrap StdLogger in their own logging
+	// helper functions add one to it for each level of wrapping.
+	CallerSkip int
+
+	// verbosity is the global V(n) threshold for this logger, shared with
+	// any children created by With so that SetVerbosity on one affects
+	// the other, as With's doc comment promises. Accessed atomically.
+	verbosity *int32
+
+	// boundFields are prepended, in order, to every message this logger
+	// and its children emit. Set via With.
+	boundFields []field
+
 	*log.Logger
 }
 
 func New(writer io.Writer, level logshim.Level) *StdLogger {
-	lg := log.New(writer, "", log.LstdFlags|log.Lshortfile)
+	lg := log.New(writer, "", log.LstdFlags)
+
+	_, err := translateLevel(level)
+	if err != nil {
+		log.Print(errorLevel, "log configuration error", err)
+		level = logshim.WarnLevel
+	}
+
+	return &StdLogger{"StdLog", level, textFormat, writer, &sync.Mutex{},
+		false, defaultCallerSkip, new(int32), nil, lg}
+}
+
+// NewJSON returns a StdLogger that emits one JSON object per log call,
+// rather than the space-separated text format used by New.
+func NewJSON(writer io.Writer, level logshim.Level) *StdLogger {
+	lg := log.New(writer, "", log.LstdFlags)
 
 	_, err := translateLevel(level)
 	if err != nil {
@@ -81,7 +137,21 @@ func New(writer io.Writer, level logshim.Level) *StdLogger {
 		level = logshim.WarnLevel
 	}
 
-	return &StdLogger{"StdLog", level, lg}
+	return &StdLogger{"StdLog", level, jsonFormat, writer, &sync.Mutex{},
+		false, defaultCallerSkip, new(int32), nil, lg}
+}
+
+// callerInfo returns the "file:line" of the stack frame skip levels above
+// its own, or "???" if it cannot be determined.
+func callerInfo(skip int) string {
+	_, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return "???"
+	}
+	if i := strings.LastIndex(file, "/"); i >= 0 {
+		file = file[i+1:]
+	}
+	return fmt.Sprintf("%s:%d", file, line)
 }
 
 func (log *StdLogger) Name() string {
@@ -94,121 +164,350 @@ func (log *StdLogger) Err(err error) logshim.Message {
 		effectiveLevel = logshim.ErrorLevel
 	}
 
-	active := log.Level >= effectiveLevel
-	msg := &stdMessage{active, effectiveLevel, &strings.Builder{}}
+	msg := log.newMessage(effectiveLevel)
 	msg.Err(err)
 	return msg
 }
 
 func (log *StdLogger) Error() logshim.Message {
-	active := log.Level >= logshim.ErrorLevel
-	msg := &stdMessage{active, logshim.ErrorLevel, &strings.Builder{}}
-	return msg
+	return log.newMessage(logshim.ErrorLevel)
 }
 
 func (log *StdLogger) Warn() logshim.Message {
-	active := log.Level >= logshim.WarnLevel
-	msg := &stdMessage{active, logshim.WarnLevel, &strings.Builder{}}
-	return msg
+	return log.newMessage(logshim.WarnLevel)
 }
 
 func (log *StdLogger) Notice() logshim.Message {
-	active := log.Level >= logshim.NoticeLevel
-	msg := &stdMessage{active, logshim.InfoLevel, &strings.Builder{}}
-	return msg
+	return log.newMessage(logshim.NoticeLevel)
 }
 
 func (log *StdLogger) Info() logshim.Message {
-	active := log.Level >= logshim.InfoLevel
-	msg := &stdMessage{active, logshim.InfoLevel, &strings.Builder{}}
-	return msg
+	return log.newMessage(logshim.InfoLevel)
 }
 
 func (log *StdLogger) Debug() logshim.Message {
-	active := log.Level >= logshim.DebugLevel
-	msg := &stdMessage{active, logshim.DebugLevel, &strings.Builder{}}
+	return log.newMessage(logshim.DebugLevel)
+}
+
+// SetVerbosity sets the global threshold for V(n) calls on this logger:
+// V(n) is active when n is less than or equal to verbosity, unless
+// overridden for the calling file by SetVModule.
+func (log *StdLogger) SetVerbosity(verbosity int) {
+	atomic.StoreInt32(log.verbosity, int32(verbosity))
+}
+
+// V returns a Message active only if level is within the current
+// verbosity, checked first against the cheap global threshold (a single
+// atomic load and integer compare) and, only if that fails, against any
+// per-module override configured with SetVModule.
+func (log *StdLogger) V(level int) logshim.Message {
+	active := log.Level >= logshim.DebugLevel &&
+		int32(level) <= atomic.LoadInt32(log.verbosity)
+
+	// V is called directly by the user, one frame shallower than
+	// Error()/Warn()/etc, which reach callerInfo via newMessage; adjust
+	// the skip depth for callerInfo and callerModule to match.
+	vSkip := log.CallerSkip - 1
+
+	if !active && vmoduleConfigured() {
+		if threshold, ok := vmoduleThreshold(callerModule(vSkip)); ok {
+			active = log.Level >= logshim.DebugLevel && int32(level) <= threshold
+		}
+	}
+
+	var caller string
+	if active && !log.DisableCaller {
+		caller = callerInfo(vSkip)
+	}
+
+	msg := &stdMessage{
+		active:  active,
+		level:   logshim.DebugLevel,
+		format:  log.format,
+		writer:  log.writer,
+		mu:      log.mu,
+		caller:  caller,
+		builder: &strings.Builder{},
+		stdlog:  log.Logger,
+	}
+	log.prependBound(msg)
+
+	return msg
+}
+
+var (
+	vmoduleMu       sync.RWMutex
+	vmodulePatterns map[string]int32
+)
+
+// SetVModule configures per-file verbosity overrides for V(n) calls from a
+// comma-separated "pattern=level" spec, e.g. "pkg1=2,pkg2=4". Each pattern
+// is matched against the base name, without its ".go" suffix, of the
+// source file making the V call.
+func SetVModule(spec string) error {
+	patterns := make(map[string]int32)
+
+	if spec != "" {
+		for _, entry := range strings.Split(spec, ",") {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid vmodule entry %q", entry)
+			}
+
+			level, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return fmt.Errorf("invalid vmodule level in %q: %w", entry, err)
+			}
+			patterns[parts[0]] = int32(level)
+		}
+	}
+
+	vmoduleMu.Lock()
+	vmodulePatterns = patterns
+	vmoduleMu.Unlock()
+
+	return nil
+}
+
+func vmoduleConfigured() bool {
+	vmoduleMu.RLock()
+	defer vmoduleMu.RUnlock()
+	return len(vmodulePatterns) > 0
+}
+
+func vmoduleThreshold(module string) (int32, bool) {
+	vmoduleMu.RLock()
+	defer vmoduleMu.RUnlock()
+	level, ok := vmodulePatterns[module]
+	return level, ok
+}
+
+// callerModule returns the base name, without its ".go" suffix, of the
+// source file skip stack frames above its own.
+func callerModule(skip int) string {
+	_, file, _, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
+	}
+	if i := strings.LastIndex(file, "/"); i >= 0 {
+		file = file[i+1:]
+	}
+	return strings.TrimSuffix(file, ".go")
+}
+
+func (log *StdLogger) newMessage(level logshim.Level) *stdMessage {
+	active := log.Level >= level
+
+	var caller string
+	if active && !log.DisableCaller {
+		caller = callerInfo(log.CallerSkip)
+	}
+
+	msg := &stdMessage{
+		active:  active,
+		level:   level,
+		format:  log.format,
+		writer:  log.writer,
+		mu:      log.mu,
+		caller:  caller,
+		builder: &strings.Builder{},
+		stdlog:  log.Logger,
+	}
+	log.prependBound(msg)
+
 	return msg
 }
 
+// prependBound writes any fields bound to log via With onto msg, ahead of
+// whatever fields the caller goes on to add.
+func (log *StdLogger) prependBound(msg *stdMessage) {
+	if !msg.active {
+		return
+	}
+	for _, f := range log.boundFields {
+		msg.add(f.key, f.val, fmt.Sprintf(" %s: %v", f.key, f.val))
+	}
+}
+
+// With returns a child logger that prepends fields to every message it
+// emits, in addition to any already bound by an ancestor With call. The
+// child shares this logger's writer, mutex and verbosity configuration,
+// so SetVerbosity on one is visible to the other. Level, DisableCaller
+// and CallerSkip are copied, so later changes to them on one logger do
+// not affect the other.
+func (log *StdLogger) With(fields ...logshim.Field) logshim.Logger {
+	bound := make([]field, 0, len(log.boundFields)+len(fields))
+	bound = append(bound, log.boundFields...)
+	for _, f := range fields {
+		bound = append(bound, field{f.Key, f.Val})
+	}
+
+	child := *log
+	child.boundFields = bound
+	return &child
+}
+
+// field is a single typed key/value pair accumulated by a stdMessage in
+// jsonFormat, retained in call order so that writeJSON can marshal the
+// output with the fields in the order they were added, rather than the
+// alphabetical order encoding/json would otherwise impose.
+type field struct {
+	key string
+	val interface{}
+}
+
 type stdMessage struct {
 	active  bool
 	level   logshim.Level
+	format  outputFormat
+	writer  io.Writer
+	mu      *sync.Mutex
+	caller  string
 	builder *strings.Builder
+	fields  []field
+
+	// stdlog is the StdLogger's own *log.Logger, built from its configured
+	// writer, used to emit the text-format line so it goes where the
+	// caller asked rather than to the log package's global default logger.
+	stdlog *log.Logger
+}
+
+func (msg *stdMessage) add(key string, val interface{}, text string) {
+	if !msg.active {
+		return
+	}
+	if msg.format == jsonFormat {
+		msg.fields = append(msg.fields, field{key, val})
+	} else {
+		msg.builder.WriteString(text)
+	}
 }
 
 func (msg *stdMessage) Err(err error) logshim.Message {
-	if msg.active {
-		msg.builder.WriteString(fmt.Sprintf(" error: %v", err))
+	var val interface{}
+	if err != nil {
+		val = err.Error()
 	}
+	msg.add("error", val, fmt.Sprintf(" error: %v", err))
 	return msg
 }
 
 func (msg *stdMessage) Bool(key string, val bool) logshim.Message {
-	if msg.active {
-		msg.builder.WriteString(fmt.Sprintf(" %s: %v", key, val))
-	}
+	msg.add(key, val, fmt.Sprintf(" %s: %v", key, val))
 	return msg
 }
 
 func (msg *stdMessage) Dur(key string, val time.Duration) logshim.Message {
-	if msg.active {
-		msg.builder.WriteString(fmt.Sprintf(" %s: %v", key, val))
-	}
+	msg.add(key, int64(val), fmt.Sprintf(" %s: %v", key, val))
 	return msg
 }
 
 func (msg *stdMessage) Int(key string, val int) logshim.Message {
-	if msg.active {
-		msg.builder.WriteString(fmt.Sprintf(" %s: %d", key, val))
-	}
+	msg.add(key, val, fmt.Sprintf(" %s: %d", key, val))
 	return msg
 }
 
 func (msg *stdMessage) Int64(key string, val int64) logshim.Message {
-	if msg.active {
-		msg.builder.WriteString(fmt.Sprintf(" %s: %d", key, val))
-	}
+	msg.add(key, val, fmt.Sprintf(" %s: %d", key, val))
 	return msg
 }
 
 func (msg *stdMessage) Uint64(key string, val uint64) logshim.Message {
-	if msg.active {
-		msg.builder.WriteString(fmt.Sprintf(" %s: %d", key, val))
-	}
+	msg.add(key, val, fmt.Sprintf(" %s: %d", key, val))
 	return msg
 }
 
 func (msg *stdMessage) Str(key string, val string) logshim.Message {
-	if msg.active {
-		msg.builder.WriteString(fmt.Sprintf(" %s: %s", key, val))
-	}
+	msg.add(key, val, fmt.Sprintf(" %s: %s", key, val))
 	return msg
 }
 
 func (msg *stdMessage) Time(key string, val time.Time) logshim.Message {
-	if msg.active {
-		msg.builder.WriteString(fmt.Sprintf(" %s: %v", key, val))
-	}
+	msg.add(key, val.Format(time.RFC3339Nano), fmt.Sprintf(" %s: %v", key, val))
 	return msg
 }
 
 func (msg *stdMessage) Msg(val string) {
-	if msg.active {
-		lvn, err := translateLevel(msg.level)
-		if err != nil {
-			// This should never happen because the Logger constructor corrects
-			// invalid level values.
-			log.Print(errorLevel, "log configuration error", err)
+	if !msg.active {
+		return
+	}
+
+	lvn, err := translateLevel(msg.level)
+	if err != nil {
+		// This should never happen because the Logger constructor corrects
+		// invalid level values.
+		log.Print(errorLevel, "log configuration error", err)
+	}
+
+	if msg.format == jsonFormat {
+		msg.writeJSON(lvn, val)
+	} else {
+		line := string(lvn)
+		if msg.caller != "" {
+			line += " " + msg.caller
 		}
+		line += msg.builder.String() + " " + val
+		msg.stdlog.Print(line)
+	}
+
+	// Once this method is called, deactivate for all future calls
+	msg.active = false
+}
+
+// writeJSON marshals the message as a single JSON object and writes it to
+// the logger's writer in one call, guarded by a mutex because, unlike the
+// text path, it does not go through log.Logger (which serialises its own
+// writes internally). The object's keys are written in a fixed order
+// (ts, level, caller, then fields in call order, then msg) rather than
+// via a map, because encoding/json always sorts map keys alphabetically
+// and would otherwise discard that ordering.
+func (msg *stdMessage) writeJSON(lvn levelName, val string) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+
+	first := appendJSONField(&b, true, "ts", time.Now().Format(time.RFC3339Nano))
+	first = appendJSONField(&b, first, "level", string(lvn))
+	if msg.caller != "" {
+		first = appendJSONField(&b, first, "caller", msg.caller)
+	}
+	for _, f := range msg.fields {
+		first = appendJSONField(&b, first, f.key, f.val)
+	}
+	appendJSONField(&b, first, "msg", val)
 
-		msg.builder.WriteString(" ")
-		msg.builder.WriteString(val)
-		log.Print(lvn, msg.builder.String())
-		// Once this method is called, deactivate for all future calls
-		msg.active = false
+	b.WriteString("}\n")
+
+	msg.mu.Lock()
+	defer msg.mu.Unlock()
+	if _, err := msg.writer.Write(b.Bytes()); err != nil {
+		log.Print(errorLevel, "log write error", err)
 	}
 }
 
+// appendJSONField appends a single "key":value pair to b, preceded by a
+// comma unless first is true. It returns false, so a sequence of calls
+// can thread the flag through without the caller tracking field count.
+func appendJSONField(b *bytes.Buffer, first bool, key string, val interface{}) bool {
+	if !first {
+		b.WriteByte(',')
+	}
+
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		keyJSON = []byte(`"?"`)
+	}
+	b.Write(keyJSON)
+	b.WriteByte(':')
+
+	valJSON, err := json.Marshal(val)
+	if err != nil {
+		valJSON = []byte(`null`)
+	}
+	b.Write(valJSON)
+
+	return false
+}
+
 func (msg *stdMessage) Msgf(format string, a ...interface{}) {
 	msg.Msg(fmt.Sprintf(format, a...))
 }
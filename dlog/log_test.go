@@ -0,0 +1,115 @@
+/*
+ * Copyright (C) 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file log_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package dlog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kjsanger/logshim"
+)
+
+func TestV_CallerReportsImmediateCallSite(t *testing.T) {
+	var buf strings.Builder
+	lg := New(&buf, logshim.DebugLevel)
+	lg.SetVerbosity(1)
+
+	func() {
+		lg.V(1).Msg("nested")
+	}()
+
+	out := buf.String()
+	if !strings.Contains(out, "log_test.go") {
+		t.Errorf("expected caller to report log_test.go, got %q", out)
+	}
+}
+
+func TestV_VModuleMatchesCallersOwnFile(t *testing.T) {
+	var buf strings.Builder
+	lg := New(&buf, logshim.DebugLevel)
+	lg.SetVerbosity(0)
+
+	if err := SetVModule("vhelper_test=5"); err != nil {
+		t.Fatalf("SetVModule: %v", err)
+	}
+	defer func() { _ = SetVModule("") }()
+
+	// callVFromHelper lives in vhelper_test.go and is invoked from here in
+	// log_test.go; the vmodule override must be keyed on the file making
+	// the V call, not the file calling that function.
+	callVFromHelper(lg, 5, "hello")
+
+	out := buf.String()
+	if !strings.Contains(out, "hello") {
+		t.Errorf("expected vmodule override to activate V(5), got %q", out)
+	}
+	if !strings.Contains(out, "vhelper_test.go") {
+		t.Errorf("expected caller to report vhelper_test.go, got %q", out)
+	}
+}
+
+func TestNewJSON_FieldsKeepCallOrder(t *testing.T) {
+	var buf strings.Builder
+	lg := NewJSON(&buf, logshim.DebugLevel)
+	lg.DisableCaller = true
+
+	lg.Info().Str("b", "second").Str("a", "first").Msg("ordered")
+
+	out := buf.String()
+	bIdx := strings.Index(out, `"b"`)
+	aIdx := strings.Index(out, `"a"`)
+	if bIdx == -1 || aIdx == -1 || bIdx > aIdx {
+		t.Errorf("expected field %q to precede field %q in call order, got %q", "b", "a", out)
+	}
+}
+
+func TestWith_SharesVerbosityWithParent(t *testing.T) {
+	var buf strings.Builder
+	lg := New(&buf, logshim.DebugLevel)
+	lg.DisableCaller = true
+	child := lg.With(logshim.Field{Key: "k", Val: "v"})
+
+	lg.SetVerbosity(3)
+	child.V(3).Msg("from child")
+
+	if !strings.Contains(buf.String(), "from child") {
+		t.Errorf("expected child logger to see verbosity set on its parent, got %q", buf.String())
+	}
+}
+
+func TestV_VModuleDoesNotMatchUnrelatedFile(t *testing.T) {
+	var buf strings.Builder
+	lg := New(&buf, logshim.DebugLevel)
+	lg.SetVerbosity(0)
+
+	if err := SetVModule("log_test=5"); err != nil {
+		t.Fatalf("SetVModule: %v", err)
+	}
+	defer func() { _ = SetVModule("") }()
+
+	// The V call itself is made in vhelper_test.go, so a pattern matching
+	// only this test file must not activate it.
+	callVFromHelper(lg, 5, "hello")
+
+	if buf.Len() != 0 {
+		t.Errorf("expected V(5) to stay inactive, got %q", buf.String())
+	}
+}
@@ -0,0 +1,28 @@
+/*
+ * Copyright (C) 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file vhelper_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package dlog
+
+// callVFromHelper calls V one function away from the test itself, and
+// from a different source file, so tests can check that both caller
+// capture and vmodule matching resolve to this file, not to the test's.
+func callVFromHelper(lg *StdLogger, level int, msg string) {
+	lg.V(level).Msg(msg)
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2019, 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file logshim.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+// Package logshim defines a minimal, backend-agnostic logging interface
+// used to decouple application code from any particular logging library.
+// Concrete backends (e.g. dlog, syslog) implement Logger and Message.
+package logshim
+
+import (
+	"context"
+	"time"
+)
+
+// Level is the severity of a log message. Levels increase in verbosity,
+// so a Logger configured at a given Level emits messages at that level
+// and every level before it.
+type Level int8
+
+const (
+	ErrorLevel Level = iota
+	WarnLevel
+	NoticeLevel
+	InfoLevel
+	DebugLevel
+)
+
+// Logger is implemented by logshim backends.
+type Logger interface {
+	Name() string
+	Err(err error) Message
+	Error() Message
+	Warn() Message
+	Notice() Message
+	Info() Message
+	Debug() Message
+	// V returns a Message active only when the logger's verbosity (global
+	// or per-module, via SetVModule) is at least level. It is intended for
+	// fine-grained debug tracing that can be enabled for one subsystem at
+	// a time.
+	V(level int) Message
+	// With returns a child Logger that prepends fields to every message it
+	// emits, in addition to any fields already bound by an ancestor With
+	// call.
+	With(fields ...Field) Logger
+}
+
+// Field is a pre-bound key/value pair carried by a Logger returned from
+// With, and by a context decorated with ContextWithFields.
+type Field struct {
+	Key string
+	Val interface{}
+}
+
+type ctxFieldsKey struct{}
+
+// ContextWithFields returns a copy of ctx carrying fields in addition to
+// any already attached by an earlier call, for later retrieval by
+// WithContext.
+func ContextWithFields(ctx context.Context, fields ...Field) context.Context {
+	existing, _ := ctx.Value(ctxFieldsKey{}).([]Field)
+
+	combined := make([]Field, 0, len(existing)+len(fields))
+	combined = append(combined, existing...)
+	combined = append(combined, fields...)
+
+	return context.WithValue(ctx, ctxFieldsKey{}, combined)
+}
+
+// WithContext returns a child of logger carrying any fields attached to ctx
+// by ContextWithFields, so that a request ID, trace ID or similar set once
+// at the top of a request appears on every subsequent log call made with
+// the returned Logger.
+func WithContext(logger Logger, ctx context.Context) Logger {
+	fields, _ := ctx.Value(ctxFieldsKey{}).([]Field)
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.With(fields...)
+}
+
+// Message accumulates key/value fields for a single log call, emitted by
+// Msg or Msgf.
+type Message interface {
+	Err(err error) Message
+	Bool(key string, val bool) Message
+	Dur(key string, val time.Duration) Message
+	Int(key string, val int) Message
+	Int64(key string, val int64) Message
+	Uint64(key string, val uint64) Message
+	Str(key string, val string) Message
+	Time(key string, val time.Time) Message
+	Msg(val string)
+	Msgf(format string, a ...interface{})
+}
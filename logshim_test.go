@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file logshim_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package logshim
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithContextReturnsLoggerUnchangedWhenNoFieldsBound(t *testing.T) {
+	base := &countingLogger{name: "base"}
+
+	got := WithContext(base, context.Background())
+
+	if got != base {
+		t.Errorf("expected WithContext to return the same Logger when ctx has no bound fields")
+	}
+}
+
+func TestWithContextAppliesFieldsBoundByContextWithFields(t *testing.T) {
+	base := &countingLogger{name: "base"}
+
+	ctx := ContextWithFields(context.Background(), Field{Key: "req", Val: "1"})
+	ctx = ContextWithFields(ctx, Field{Key: "user", Val: "alice"})
+
+	got := WithContext(base, ctx)
+
+	if got == base {
+		t.Errorf("expected WithContext to return a child Logger carrying the bound fields")
+	}
+
+	child, ok := got.(*countingLogger)
+	if !ok {
+		t.Fatalf("expected WithContext to return a *countingLogger, got %T", got)
+	}
+	if len(child.fields) != 2 ||
+		child.fields[0] != (Field{Key: "req", Val: "1"}) ||
+		child.fields[1] != (Field{Key: "user", Val: "alice"}) {
+		t.Errorf("expected child to carry req=1 and user=alice in order, got %v", child.fields)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file multi.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package logshim
+
+import "time"
+
+// MultiLogger is a Logger that fans every call out to a set of sink
+// Loggers, each of which keeps its own Level threshold and rendering
+// (text, JSON, syslog, ...). Each field, and the final Msg/Msgf call, is
+// passed to every sink's own Message in turn; a sink whose Level check
+// rejected the message discards it. The fields are not captured once and
+// shared between sinks: each sink's Message receives and handles them
+// itself.
+type MultiLogger struct {
+	name  string
+	sinks []Logger
+}
+
+// NewMultiLogger returns a MultiLogger that dispatches every call to each
+// of sinks, in order.
+func NewMultiLogger(sinks ...Logger) *MultiLogger {
+	return &MultiLogger{name: "MultiLog", sinks: sinks}
+}
+
+func (log *MultiLogger) Name() string {
+	return log.name
+}
+
+func (log *MultiLogger) Err(err error) Message {
+	return log.open(func(sink Logger) Message { return sink.Err(err) })
+}
+
+func (log *MultiLogger) Error() Message {
+	return log.open(Logger.Error)
+}
+
+func (log *MultiLogger) Warn() Message {
+	return log.open(Logger.Warn)
+}
+
+func (log *MultiLogger) Notice() Message {
+	return log.open(Logger.Notice)
+}
+
+func (log *MultiLogger) Info() Message {
+	return log.open(Logger.Info)
+}
+
+func (log *MultiLogger) Debug() Message {
+	return log.open(Logger.Debug)
+}
+
+func (log *MultiLogger) V(level int) Message {
+	return log.open(func(sink Logger) Message { return sink.V(level) })
+}
+
+// With returns a MultiLogger whose sinks are themselves the result of
+// calling With on each of this logger's sinks.
+func (log *MultiLogger) With(fields ...Field) Logger {
+	sinks := make([]Logger, len(log.sinks))
+	for i, sink := range log.sinks {
+		sinks[i] = sink.With(fields...)
+	}
+	return &MultiLogger{name: log.name, sinks: sinks}
+}
+
+func (log *MultiLogger) open(start func(Logger) Message) *multiMessage {
+	msgs := make([]Message, len(log.sinks))
+	for i, sink := range log.sinks {
+		msgs[i] = start(sink)
+	}
+	return &multiMessage{msgs: msgs}
+}
+
+// multiMessage fans each field and the final Msg/Msgf call out to every
+// sink's own Message.
+type multiMessage struct {
+	msgs []Message
+}
+
+func (msg *multiMessage) Err(err error) Message {
+	for _, m := range msg.msgs {
+		m.Err(err)
+	}
+	return msg
+}
+
+func (msg *multiMessage) Bool(key string, val bool) Message {
+	for _, m := range msg.msgs {
+		m.Bool(key, val)
+	}
+	return msg
+}
+
+func (msg *multiMessage) Dur(key string, val time.Duration) Message {
+	for _, m := range msg.msgs {
+		m.Dur(key, val)
+	}
+	return msg
+}
+
+func (msg *multiMessage) Int(key string, val int) Message {
+	for _, m := range msg.msgs {
+		m.Int(key, val)
+	}
+	return msg
+}
+
+func (msg *multiMessage) Int64(key string, val int64) Message {
+	for _, m := range msg.msgs {
+		m.Int64(key, val)
+	}
+	return msg
+}
+
+func (msg *multiMessage) Uint64(key string, val uint64) Message {
+	for _, m := range msg.msgs {
+		m.Uint64(key, val)
+	}
+	return msg
+}
+
+func (msg *multiMessage) Str(key string, val string) Message {
+	for _, m := range msg.msgs {
+		m.Str(key, val)
+	}
+	return msg
+}
+
+func (msg *multiMessage) Time(key string, val time.Time) Message {
+	for _, m := range msg.msgs {
+		m.Time(key, val)
+	}
+	return msg
+}
+
+func (msg *multiMessage) Msg(val string) {
+	for _, m := range msg.msgs {
+		m.Msg(val)
+	}
+}
+
+func (msg *multiMessage) Msgf(format string, a ...interface{}) {
+	for _, m := range msg.msgs {
+		m.Msgf(format, a...)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file multi_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package logshim
+
+import (
+	"testing"
+	"time"
+)
+
+type countingLogger struct {
+	name   string
+	calls  []string
+	fields []Field
+}
+
+func (c *countingLogger) Name() string { return c.name }
+
+func (c *countingLogger) Err(err error) Message { return c.record("Err") }
+
+func (c *countingLogger) Error() Message { return c.record("Error") }
+
+func (c *countingLogger) Warn() Message { return c.record("Warn") }
+
+func (c *countingLogger) Notice() Message { return c.record("Notice") }
+
+func (c *countingLogger) Info() Message { return c.record("Info") }
+
+func (c *countingLogger) Debug() Message { return c.record("Debug") }
+
+func (c *countingLogger) V(level int) Message { return c.record("V") }
+
+func (c *countingLogger) With(fields ...Field) Logger {
+	c.calls = append(c.calls, "With")
+	return &countingLogger{name: c.name, fields: fields}
+}
+
+func (c *countingLogger) record(call string) Message {
+	c.calls = append(c.calls, call)
+	return &countingMessage{}
+}
+
+type countingMessage struct{ msgs []string }
+
+func (m *countingMessage) Err(err error) Message                      { return m }
+func (m *countingMessage) Bool(key string, val bool) Message          { return m }
+func (m *countingMessage) Dur(key string, val time.Duration) Message  { return m }
+func (m *countingMessage) Int(key string, val int) Message            { return m }
+func (m *countingMessage) Int64(key string, val int64) Message        { return m }
+func (m *countingMessage) Uint64(key string, val uint64) Message      { return m }
+func (m *countingMessage) Str(key string, val string) Message         { return m }
+func (m *countingMessage) Time(key string, val time.Time) Message     { return m }
+func (m *countingMessage) Msg(val string)                             { m.msgs = append(m.msgs, val) }
+func (m *countingMessage) Msgf(format string, a ...interface{})       { m.msgs = append(m.msgs, format) }
+
+func TestMultiLoggerFansOutToEverySink(t *testing.T) {
+	a := &countingLogger{name: "a"}
+	b := &countingLogger{name: "b"}
+	multi := NewMultiLogger(a, b)
+
+	multi.Info().Str("k", "v").Msg("hello")
+
+	if len(a.calls) != 1 || a.calls[0] != "Info" {
+		t.Errorf("expected sink a to see one Info call, got %v", a.calls)
+	}
+	if len(b.calls) != 1 || b.calls[0] != "Info" {
+		t.Errorf("expected sink b to see one Info call, got %v", b.calls)
+	}
+}
+
+func TestMultiLoggerWithAppliesToEverySink(t *testing.T) {
+	a := &countingLogger{name: "a"}
+	b := &countingLogger{name: "b"}
+	multi := NewMultiLogger(a, b)
+
+	child := multi.With(Field{Key: "req", Val: "123"})
+
+	if _, ok := child.(*MultiLogger); !ok {
+		t.Fatalf("expected With to return a *MultiLogger, got %T", child)
+	}
+	if len(a.calls) != 1 || a.calls[0] != "With" {
+		t.Errorf("expected sink a to see one With call, got %v", a.calls)
+	}
+	if len(b.calls) != 1 || b.calls[0] != "With" {
+		t.Errorf("expected sink b to see one With call, got %v", b.calls)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file rotate.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+// Package rotate provides an io.WriteCloser that rotates a log file by
+// size and/or age, for use as the writer passed to a logshim backend such
+// as dlog.New, so that callers do not have to wrap os.File themselves.
+package rotate
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Writer is an io.WriteCloser backed by a file at Path, which is renamed
+// aside and reopened before a write that would take it past MaxSize bytes,
+// or once it has been open for MaxAge. A zero MaxSize or MaxAge disables
+// that trigger.
+type Writer struct {
+	Path    string
+	MaxSize int64
+	MaxAge  time.Duration
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// New returns a Writer that appends to, and rotates, the file at path.
+func New(path string, maxSize int64, maxAge time.Duration) *Writer {
+	return &Writer{Path: path, MaxSize: maxSize, MaxAge: maxAge}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.ensureOpen(); err != nil {
+		return 0, err
+	}
+	if w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("failed to write to log file %s: %w", w.Path, err)
+	}
+	return n, nil
+}
+
+// Close closes the underlying file, if one is currently open.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close log file %s: %w", w.Path, err)
+	}
+	return nil
+}
+
+func (w *Writer) ensureOpen() error {
+	if w.file != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(w.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", w.Path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", w.Path, err)
+	}
+
+	w.file = f
+	w.size = info.Size()
+	w.opened = time.Now()
+	return nil
+}
+
+func (w *Writer) shouldRotate(next int) bool {
+	if w.MaxSize > 0 && w.size+int64(next) > w.MaxSize {
+		return true
+	}
+	if w.MaxAge > 0 && time.Since(w.opened) >= w.MaxAge {
+		return true
+	}
+	return false
+}
+
+// rotate closes the current file, renames it aside with a timestamp
+// suffix, and opens a fresh file at Path in its place.
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file %s: %w", w.Path, err)
+	}
+	w.file = nil
+
+	backup, err := w.backupPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(w.Path, backup); err != nil {
+		return fmt.Errorf("failed to rotate log file %s: %w", w.Path, err)
+	}
+
+	return w.ensureOpen()
+}
+
+// backupPath returns the path to rename Path to for this rotation, timestamped
+// to the current second. MaxSize-triggered rotations can happen more than
+// once within the same second, so if that path is already taken by an
+// earlier rotation, a "-N" counter is appended until a free path is found,
+// rather than letting os.Rename silently overwrite it.
+func (w *Writer) backupPath() (string, error) {
+	base := fmt.Sprintf("%s.%s", w.Path, time.Now().Format("20060102T150405"))
+
+	path := base
+	for n := 1; ; n++ {
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return path, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to check backup path %s: %w", path, err)
+		}
+		path = fmt.Sprintf("%s-%d", base, n)
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file rotate_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package rotate
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestWriteRotatesWithoutLosingBackups guards against successive
+// MaxSize-triggered rotations within the same second colliding on one
+// timestamped backup path and silently overwriting each other.
+func TestWriteRotatesWithoutLosingBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	w := New(path, 10, 0)
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := w.Write([]byte("0123456789")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 4 {
+		t.Errorf("expected 4 rotated backups, got %d: %v", len(matches), matches)
+	}
+}
@@ -0,0 +1,404 @@
+/*
+ * Copyright (C) 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file syslog.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+// Package syslog is a logshim backend that emits RFC 5424 structured syslog
+// messages, either to the local syslog daemon over a Unix socket, or to a
+// remote collector over UDP, TCP or TLS.
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kjsanger/logshim"
+)
+
+// These are the local syslog socket paths tried, in order, by Dial.
+var localSocketPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+type severity int
+
+const (
+	sevErr     severity = 3
+	sevWarning severity = 4
+	sevNotice  severity = 5
+	sevInfo    severity = 6
+	sevDebug   severity = 7
+)
+
+// FacilityLocal0 is the default facility used for messages sent by this
+// package, matching the common convention for application-defined logging.
+const FacilityLocal0 = 16
+
+const rfc5424Version = 1
+const nilValue = "-"
+
+func translateSeverity(level logshim.Level) (severity, error) {
+	var (
+		sev severity
+		err error
+	)
+
+	switch level {
+	case logshim.ErrorLevel:
+		sev = sevErr
+	case logshim.WarnLevel:
+		sev = sevWarning
+	case logshim.NoticeLevel:
+		sev = sevNotice
+	case logshim.InfoLevel:
+		sev = sevInfo
+	case logshim.DebugLevel:
+		sev = sevDebug
+	default:
+		sev = sevWarning
+		err = fmt.Errorf("invalid log level %d, defaulting to "+
+			"WARN severity", level)
+	}
+
+	return sev, err
+}
+
+// Logger is a logshim.Logger that writes RFC 5424-framed messages to a
+// local or remote syslog receiver.
+type Logger struct {
+	name        string
+	Level       logshim.Level
+	facility    int
+	sdID        string
+	hostname    string
+	appName     string
+	procID      string
+	mu          *sync.Mutex
+	conn        net.Conn
+	// verbosity is the V(n) threshold for this logger, shared with any
+	// children created by With so that SetVerbosity on one affects the
+	// other. Accessed atomically.
+	verbosity   *int32
+	boundParams []sdParam
+}
+
+// Dial connects to the local syslog daemon over its Unix socket, trying each
+// of the well-known socket paths in turn.
+func Dial(level logshim.Level, sdID string) (*Logger, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	for _, path := range localSocketPaths {
+		conn, err = net.Dial("unixgram", path)
+		if err == nil {
+			break
+		}
+		conn, err = net.Dial("unix", path)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial local syslog socket: %w", err)
+	}
+
+	return newLogger(conn, level, sdID), nil
+}
+
+// DialRemote connects to a remote syslog receiver over the given network
+// ("udp" or "tcp") and address.
+func DialRemote(network, addr string, level logshim.Level, sdID string) (*Logger, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial remote syslog receiver %s %s: %w",
+			network, addr, err)
+	}
+
+	return newLogger(conn, level, sdID), nil
+}
+
+// DialTLS connects to a remote syslog receiver over TLS on the given
+// address, using the supplied TLS configuration.
+func DialTLS(addr string, tlsConfig *tls.Config, level logshim.Level, sdID string) (*Logger, error) {
+	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial remote syslog receiver over TLS %s: %w",
+			addr, err)
+	}
+
+	return newLogger(conn, level, sdID), nil
+}
+
+func newLogger(conn net.Conn, level logshim.Level, sdID string) *Logger {
+	_, err := translateSeverity(level)
+	if err != nil {
+		log.Print(err)
+		level = logshim.WarnLevel
+	}
+
+	hostname, hostErr := os.Hostname()
+	if hostErr != nil {
+		hostname = nilValue
+	}
+
+	return &Logger{
+		name:      "SyslogLog",
+		Level:     level,
+		facility:  FacilityLocal0,
+		sdID:      sdID,
+		hostname:  hostname,
+		appName:   filepathBase(os.Args[0]),
+		procID:    strconv.Itoa(os.Getpid()),
+		mu:        &sync.Mutex{},
+		conn:      conn,
+		verbosity: new(int32),
+	}
+}
+
+func filepathBase(path string) string {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+func (log *Logger) Name() string {
+	return log.name
+}
+
+func (log *Logger) Err(err error) logshim.Message {
+	effectiveLevel := logshim.InfoLevel
+	if err != nil {
+		effectiveLevel = logshim.ErrorLevel
+	}
+
+	msg := log.newMessage(effectiveLevel)
+	msg.Err(err)
+	return msg
+}
+
+func (log *Logger) Error() logshim.Message {
+	return log.newMessage(logshim.ErrorLevel)
+}
+
+func (log *Logger) Warn() logshim.Message {
+	return log.newMessage(logshim.WarnLevel)
+}
+
+func (log *Logger) Notice() logshim.Message {
+	return log.newMessage(logshim.NoticeLevel)
+}
+
+func (log *Logger) Info() logshim.Message {
+	return log.newMessage(logshim.InfoLevel)
+}
+
+func (log *Logger) Debug() logshim.Message {
+	return log.newMessage(logshim.DebugLevel)
+}
+
+// SetVerbosity sets the threshold for V(n) calls on this logger: V(n) is
+// active when n is less than or equal to verbosity.
+func (log *Logger) SetVerbosity(verbosity int) {
+	atomic.StoreInt32(log.verbosity, int32(verbosity))
+}
+
+// V returns a Message active only if level is within the logger's current
+// verbosity. Unlike dlog.StdLogger, this backend has no per-module
+// override; it checks only the single global threshold.
+func (log *Logger) V(level int) logshim.Message {
+	active := log.Level >= logshim.DebugLevel &&
+		int32(level) <= atomic.LoadInt32(log.verbosity)
+
+	msg := &sdMessage{
+		active: active,
+		level:  logshim.DebugLevel,
+		logger: log,
+	}
+	if msg.active {
+		msg.params = append(msg.params, log.boundParams...)
+	}
+
+	return msg
+}
+
+// With returns a child logger that prepends params to every message it
+// emits, in addition to any already bound by an ancestor With call. The
+// child shares this logger's connection, mutex and verbosity
+// configuration, so that writes from the parent and any of its
+// With-derived children are still mutually exclusive on the shared
+// connection, and SetVerbosity on one is visible to the other. Level is
+// copied, so a later change to it on one logger does not affect the other.
+func (log *Logger) With(fields ...logshim.Field) logshim.Logger {
+	bound := make([]sdParam, 0, len(log.boundParams)+len(fields))
+	bound = append(bound, log.boundParams...)
+	for _, f := range fields {
+		bound = append(bound, sdParam{f.Key, fmt.Sprintf("%v", f.Val)})
+	}
+
+	child := *log
+	child.boundParams = bound
+	return &child
+}
+
+func (log *Logger) newMessage(level logshim.Level) *sdMessage {
+	msg := &sdMessage{
+		active: log.Level >= level,
+		level:  level,
+		logger: log,
+	}
+	if msg.active {
+		msg.params = append(msg.params, log.boundParams...)
+	}
+	return msg
+}
+
+// sdParam is a single SD-PARAM, a key/value pair carried in the
+// STRUCTURED-DATA section of an RFC 5424 message.
+type sdParam struct {
+	key string
+	val string
+}
+
+type sdMessage struct {
+	active bool
+	level  logshim.Level
+	logger *Logger
+	params []sdParam
+}
+
+func (msg *sdMessage) addParam(key, val string) {
+	if msg.active {
+		msg.params = append(msg.params, sdParam{key, val})
+	}
+}
+
+func (msg *sdMessage) Err(err error) logshim.Message {
+	msg.addParam("error", fmt.Sprintf("%v", err))
+	return msg
+}
+
+func (msg *sdMessage) Bool(key string, val bool) logshim.Message {
+	msg.addParam(key, strconv.FormatBool(val))
+	return msg
+}
+
+func (msg *sdMessage) Dur(key string, val time.Duration) logshim.Message {
+	msg.addParam(key, val.String())
+	return msg
+}
+
+func (msg *sdMessage) Int(key string, val int) logshim.Message {
+	msg.addParam(key, strconv.Itoa(val))
+	return msg
+}
+
+func (msg *sdMessage) Int64(key string, val int64) logshim.Message {
+	msg.addParam(key, strconv.FormatInt(val, 10))
+	return msg
+}
+
+func (msg *sdMessage) Uint64(key string, val uint64) logshim.Message {
+	msg.addParam(key, strconv.FormatUint(val, 10))
+	return msg
+}
+
+func (msg *sdMessage) Str(key string, val string) logshim.Message {
+	msg.addParam(key, val)
+	return msg
+}
+
+func (msg *sdMessage) Time(key string, val time.Time) logshim.Message {
+	msg.addParam(key, val.Format(time.RFC3339Nano))
+	return msg
+}
+
+func (msg *sdMessage) Msg(val string) {
+	if !msg.active {
+		return
+	}
+
+	sev, err := translateSeverity(msg.level)
+	if err != nil {
+		// This should never happen because the Logger constructor corrects
+		// invalid level values.
+		sev = sevWarning
+	}
+
+	line := msg.format(sev, val)
+
+	msg.logger.mu.Lock()
+	defer msg.logger.mu.Unlock()
+	if _, writeErr := msg.logger.conn.Write([]byte(line)); writeErr != nil {
+		fmt.Fprintf(os.Stderr, "syslog write error: %v\n", writeErr)
+	}
+
+	// Once this method is called, deactivate for all future calls
+	msg.active = false
+}
+
+func (msg *sdMessage) Msgf(format string, a ...interface{}) {
+	msg.Msg(fmt.Sprintf(format, a...))
+}
+
+func (msg *sdMessage) format(sev severity, val string) string {
+	pri := msg.logger.facility*8 + int(sev)
+	timestamp := time.Now().Format("2006-01-02T15:04:05.000000Z07:00")
+
+	return fmt.Sprintf("<%d>%d %s %s %s %s %s %s %s\n",
+		pri, rfc5424Version, timestamp, msg.logger.hostname,
+		msg.logger.appName, msg.logger.procID, nilValue,
+		msg.structuredData(), val)
+}
+
+// structuredData renders the accumulated SD-PARAMs as a single RFC 5424
+// SD-ELEMENT under the logger's configured SD-ID, or "-" if there are none.
+func (msg *sdMessage) structuredData() string {
+	if len(msg.params) == 0 {
+		return nilValue
+	}
+
+	var b strings.Builder
+	b.WriteString("[")
+	b.WriteString(msg.logger.sdID)
+	for _, p := range msg.params {
+		b.WriteString(" ")
+		b.WriteString(p.key)
+		b.WriteString(`="`)
+		b.WriteString(escapeParamValue(p.val))
+		b.WriteString(`"`)
+	}
+	b.WriteString("]")
+
+	return b.String()
+}
+
+// escapeParamValue escapes the characters RFC 5424 requires to be escaped
+// within a PARAM-VALUE: '"', '\' and ']'.
+func escapeParamValue(val string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	return replacer.Replace(val)
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file syslog_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package syslog
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kjsanger/logshim"
+)
+
+// TestWithSharesMutexWithParent guards against a parent Logger and a
+// With-derived child racing on their shared connection: they must block
+// on the same mutex, not each hold an independent copy of it.
+func TestWithSharesMutexWithParent(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	parent := newLogger(client, logshim.InfoLevel, "test@1")
+	child := parent.With(logshim.Field{Key: "k", Val: "v"}).(*Logger)
+
+	if parent.mu != child.mu {
+		t.Fatal("expected child logger to share its parent's mutex")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(log *Logger) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				log.Info().Msg("concurrent")
+			}
+		}(parent)
+	}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(log *Logger) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				log.Info().Msg("concurrent")
+			}
+		}(child)
+	}
+	wg.Wait()
+}
+
+// TestWithSharesVerbosityWithParent guards against a With-derived child
+// becoming disconnected from its parent's verbosity threshold: SetVerbosity
+// on the parent must be visible to the child, and vice versa.
+func TestWithSharesVerbosityWithParent(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := server.Read(buf)
+			if err != nil {
+				return
+			}
+			received <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	parent := newLogger(client, logshim.DebugLevel, "test@1")
+	child := parent.With(logshim.Field{Key: "k", Val: "v"}).(*Logger)
+
+	parent.SetVerbosity(3)
+	child.V(3).Msg("from child")
+
+	select {
+	case line := <-received:
+		if !strings.Contains(string(line), "from child") {
+			t.Errorf("expected child to see verbosity set on its parent, got %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected child to see verbosity set on its parent, nothing was written")
+	}
+}